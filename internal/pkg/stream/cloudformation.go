@@ -1,17 +1,235 @@
 package stream
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"golang.org/x/time/rate"
 )
 
 const (
-	stackFetchIntervalDuration = 3 * time.Second // How long to wait until Fetch is called again for a StackStreamer.
+	// idleFetchInterval is how long to wait before the next Fetch when the last one returned no new events.
+	idleFetchInterval = 10 * time.Second
+	// activeFetchInterval is how long to wait before the next Fetch when resources are actively changing.
+	activeFetchInterval = 1 * time.Second
+	// defaultFetchInterval is used when events were seen but none indicate that a resource is in progress.
+	defaultFetchInterval = 3 * time.Second
+
+	// baseBackoff and maxBackoff bound the exponential backoff applied after a throttled Fetch.
+	baseBackoff = 1 * time.Second
+	maxBackoff  = 30 * time.Second
+
+	// defaultRateLimit is CloudFormation's approximate per-account soft limit for DescribeStackEvents.
+	defaultRateLimit rate.Limit = 1
+
+	nestedStackResourceType = "AWS::CloudFormation::Stack"
+
+	// subscriberQueueSize is the number of events buffered per subscription before its drop policy kicks in.
+	subscriberQueueSize = 256
+)
+
+// SubscriberPolicy controls how a subscription behaves when its internal queue fills up because
+// the subscriber isn't draining events fast enough.
+type SubscriberPolicy int
+
+const (
+	// BlockingSubscriber blocks Notify until the subscriber catches up. This is the default.
+	BlockingSubscriber SubscriberPolicy = iota
+	// DropOldestSubscriber discards the oldest buffered event to make room for the new one, like a ring buffer.
+	DropOldestSubscriber
+	// DropNewestSubscriber discards the incoming event instead of waiting for room.
+	DropNewestSubscriber
 )
 
+// StreamerOption configures a StackStreamer created by NewStackStreamer.
+type StreamerOption func(*StackStreamer)
+
+// WithRateLimiter sets the token-bucket rate limiter that Fetch must acquire a token from before
+// calling DescribeStackEvents. Pass the same limiter to multiple StackStreamers (e.g. ones created
+// for parallel deploys) so that they coordinate and don't collectively exceed CloudFormation's
+// request limits. If this option isn't used, the StackStreamer falls back to a limiter of its own.
+func WithRateLimiter(l *rate.Limiter) StreamerOption {
+	return func(s *StackStreamer) {
+		s.limiter = l
+	}
+}
+
+// isThrottlingError returns true if err is an AWS error indicating that requests are being throttled.
+func isThrottlingError(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	switch aerr.Code() {
+	case "Throttling", "ThrottlingException", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
+
+// jitteredBackoff returns a random duration between 0 and min(maxBackoff, baseBackoff*2^attempt),
+// i.e. exponential backoff with "full jitter".
+func jitteredBackoff(attempt int) time.Duration {
+	backoff := baseBackoff * time.Duration(int64(1)<<uint(attempt))
+	if backoff <= 0 || backoff > maxBackoff { // Guard against overflow for large attempt counts.
+		backoff = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// nextFetchInterval chooses how long to wait before the next Fetch based on what this Fetch saw:
+// poll quickly while resources are actively changing, back off while idle.
+func nextFetchInterval(events []StackEvent) time.Duration {
+	if len(events) == 0 {
+		return idleFetchInterval
+	}
+	for _, event := range events {
+		if isInProgressStatus(event.ResourceStatus) {
+			return activeFetchInterval
+		}
+	}
+	return defaultFetchInterval
+}
+
+// isInProgressStatus returns true if status indicates a resource is still being created, updated, or deleted.
+func isInProgressStatus(status string) bool {
+	return strings.HasSuffix(status, "_IN_PROGRESS")
+}
+
+// subscription delivers events to a single subscriber channel through a bounded, policy-governed
+// queue so that a slow subscriber doesn't stall the streamer or other subscribers while its queue
+// has room. Once the queue is full, a BlockingSubscriber subscription stalls them until it drains.
+//
+// The queue is a plain slice guarded by mu, not a channel: forward is its only reader and enqueue
+// is its only writer/evictor, so a drop policy that evicts from the queue can never race against
+// forward concurrently receiving the very same slot.
+type subscription struct {
+	out    chan StackEvent
+	policy SubscriberPolicy
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []StackEvent
+	closed bool
+
+	dropped int32 // Accessed atomically; number of events discarded because the queue was full.
+}
+
+func newSubscription(out chan StackEvent, policy SubscriberPolicy) *subscription {
+	sub := &subscription{
+		out:    out,
+		policy: policy,
+	}
+	sub.cond = sync.NewCond(&sub.mu)
+	go sub.forward()
+	return sub
+}
+
+// forward drains the subscription's queue to its subscriber's channel one event at a time until
+// the queue is closed and drained, then closes the subscriber's channel in turn.
+func (sub *subscription) forward() {
+	for {
+		sub.mu.Lock()
+		for len(sub.queue) == 0 && !sub.closed {
+			sub.cond.Wait()
+		}
+		if len(sub.queue) == 0 && sub.closed {
+			sub.mu.Unlock()
+			break
+		}
+		event := sub.queue[0]
+		sub.queue = sub.queue[1:]
+		sub.cond.Signal() // Wake a BlockingSubscriber enqueue that's waiting for room.
+		sub.mu.Unlock()
+
+		sub.out <- event
+	}
+	close(sub.out)
+}
+
+// enqueue adds event to the subscription's queue, applying its drop policy if the queue is full.
+func (sub *subscription) enqueue(event StackEvent) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	switch sub.policy {
+	case DropNewestSubscriber:
+		if len(sub.queue) >= subscriberQueueSize {
+			atomic.AddInt32(&sub.dropped, 1)
+			return
+		}
+	case DropOldestSubscriber:
+		if len(sub.queue) >= subscriberQueueSize {
+			sub.queue = sub.queue[1:]
+			atomic.AddInt32(&sub.dropped, 1)
+		}
+	default: // BlockingSubscriber
+		for len(sub.queue) >= subscriberQueueSize {
+			sub.cond.Wait()
+		}
+	}
+	sub.queue = append(sub.queue, event)
+	sub.cond.Signal()
+}
+
+// close marks the subscription closed so forward drains whatever's left in the queue and stops.
+func (sub *subscription) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.closed = true
+	sub.cond.Signal()
+}
+
+// nestedStackInProgressStatuses are the statuses on a AWS::CloudFormation::Stack resource event
+// that indicate a nested stack has started executing and should be streamed in turn.
+var nestedStackInProgressStatuses = map[string]bool{
+	"CREATE_IN_PROGRESS": true,
+	"UPDATE_IN_PROGRESS": true,
+}
+
+// terminalStatuses are the CloudFormation stack statuses that indicate a change set has finished executing,
+// successfully or not.
+var terminalStatuses = map[string]bool{
+	"CREATE_COMPLETE":          true,
+	"CREATE_FAILED":            true,
+	"UPDATE_COMPLETE":          true,
+	"DELETE_COMPLETE":          true,
+	"DELETE_FAILED":            true,
+	"ROLLBACK_COMPLETE":        true,
+	"ROLLBACK_FAILED":          true,
+	"UPDATE_ROLLBACK_COMPLETE": true,
+	"UPDATE_ROLLBACK_FAILED":   true,
+}
+
+// failureStatusPattern matches resource statuses that end in _FAILED or start with ROLLBACK_.
+// Update rollback statuses such as UPDATE_ROLLBACK_IN_PROGRESS are not matched.
+var failureStatusPattern = regexp.MustCompile(`_FAILED$|^ROLLBACK_`)
+
+// IsSuccess returns true if the given stack status indicates the change set completed without rolling back.
+func IsSuccess(status string) bool {
+	switch status {
+	case "CREATE_COMPLETE", "UPDATE_COMPLETE", "DELETE_COMPLETE":
+		return true
+	}
+	return false
+}
+
+// StackResult is the final status of a StackStreamer's stack, along with why it failed, if it did.
+type StackResult struct {
+	Status         string
+	FailureReasons []string
+}
+
 // StackEventsDescriber is the CloudFormation interface needed to describe stack events.
 type StackEventsDescriber interface {
 	DescribeStackEvents(*cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error)
@@ -23,41 +241,120 @@ type StackEvent struct {
 	ResourceType         string
 	ResourceStatus       string
 	ResourceStatusReason string
+
+	// Prefix is the slash-separated chain of ancestor nested stacks' logical IDs that this event
+	// was raised under, e.g. "Env/Addons/", empty for events on the root stack.
+	Prefix string
 }
 
 // StackStreamer is a FetchNotifyStopper for StackEvent events started by a change set.
 type StackStreamer struct {
 	client                StackEventsDescriber
 	stackName             string
+	rootName              string // The stack's own name, used to recognize its root StackEvent regardless of whether stackName is an ARN.
+	prefix                string // Slash-separated chain of ancestor nested stacks' logical IDs, empty for the root stack.
 	changeSetCreationTime time.Time
 
-	subscribers   []chan StackEvent
-	pastEventIDs  map[string]bool
-	eventsToFlush []StackEvent
+	subscribers    []*subscription
+	pastEventIDs   map[string]bool
+	eventsToFlush  []StackEvent
+	failureReasons []string
+
+	children       []*StackStreamer
+	nestedStackIDs map[string]bool // Physical IDs of nested stacks that already have a child StackStreamer.
+
+	limiter        *rate.Limiter
+	backoffAttempt int       // Consecutive throttled Fetch calls, reset on success.
+	nextFetchAt    time.Time // When this streamer should next be fetched as a child; zero means "now". Unused on the root, which is driven externally.
+
+	done   chan StackResult
+	isDone bool
 }
 
 // NewStackStreamer creates a StackStreamer from a cloudformation client, stack name, and the change set creation timestamp.
-func NewStackStreamer(cfn StackEventsDescriber, stackName string, csCreationTime time.Time) *StackStreamer {
-	return &StackStreamer{
+func NewStackStreamer(cfn StackEventsDescriber, stackName string, csCreationTime time.Time, opts ...StreamerOption) *StackStreamer {
+	return newStackStreamer(cfn, stackName, "", csCreationTime, opts...)
+}
+
+// newStackStreamer creates a StackStreamer for stackName (a name or ARN), tagging every StackEvent it
+// produces with prefix so that nested-stack events can be rendered hierarchically.
+func newStackStreamer(cfn StackEventsDescriber, stackName, prefix string, csCreationTime time.Time, opts ...StreamerOption) *StackStreamer {
+	s := &StackStreamer{
 		client:                cfn,
 		stackName:             stackName,
+		rootName:              stackNameFromID(stackName),
+		prefix:                prefix,
 		changeSetCreationTime: csCreationTime,
 		pastEventIDs:          make(map[string]bool),
+		nestedStackIDs:        make(map[string]bool),
+		done:                  make(chan StackResult, 1),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.limiter == nil {
+		s.limiter = rate.NewLimiter(defaultRateLimit, 1)
 	}
+	return s
 }
 
-// Subscribe registers the channels to receive notifications from the streamer.
-func (s *StackStreamer) Subscribe(channels ...chan StackEvent) {
-	s.subscribers = append(s.subscribers, channels...)
+// stackNameFromID returns the stack's own name given either a plain stack name or a stack ARN
+// of the form "arn:aws:cloudformation:region:account:stack/name/unique-id".
+func stackNameFromID(id string) string {
+	if !strings.HasPrefix(id, "arn:") {
+		return id
+	}
+	parts := strings.Split(id, "/")
+	if len(parts) < 2 {
+		return id
+	}
+	return parts[1]
+}
+
+// Done returns a channel that's sent the stack's final StackResult once the root stack
+// reaches a terminal CloudFormation status. The channel is closed after the result is sent.
+func (s *StackStreamer) Done() <-chan StackResult {
+	return s.done
+}
+
+// Subscribe registers ch to receive notifications from the streamer, buffering up to
+// subscriberQueueSize events for it and applying policy once that buffer fills up.
+//
+// Subscribe must be called before the first Fetch: nested stack streamers spawned by Fetch take a
+// snapshot of the subscriber list at spawn time, so a subscriber added afterward won't receive
+// events from any nested stack that's already been discovered.
+func (s *StackStreamer) Subscribe(ch chan StackEvent, policy SubscriberPolicy) {
+	s.subscribers = append(s.subscribers, newSubscription(ch, policy))
+}
+
+// Dropped returns the number of events that were discarded for ch because its queue was full,
+// for subscriptions using DropOldestSubscriber or DropNewestSubscriber. It returns 0 if ch isn't
+// a known subscriber or hasn't dropped any events.
+func (s *StackStreamer) Dropped(ch chan StackEvent) int {
+	for _, sub := range s.subscribers {
+		if sub.out == ch {
+			return int(atomic.LoadInt32(&sub.dropped))
+		}
+	}
+	return 0
 }
 
 // Fetch retrieves and stores any new CloudFormation stack events since the ChangeSetCreationTime in chronological order.
 // If an error occurs from describe stack events, returns a wrapped error.
 // Otherwise, returns the time the next Fetch should be attempted.
 func (s *StackStreamer) Fetch() (next time.Time, err error) {
+	if s.isDone {
+		return next, nil
+	}
+
 	var events []StackEvent
 	var nextToken *string
+	var terminalStatus string
 	for {
+		if err := s.limiter.Wait(context.Background()); err != nil {
+			return next, fmt.Errorf("wait for rate limiter: %w", err)
+		}
+
 		// DescribeStackEvents returns events in reverse chronological order,
 		// so we retrieve new events until we go past the ChangeSetCreationTime or we see an already seen event ID.
 		// This logic is taken from the AWS CDK:
@@ -67,8 +364,19 @@ func (s *StackStreamer) Fetch() (next time.Time, err error) {
 			StackName: aws.String(s.stackName),
 		})
 		if err != nil {
+			if isThrottlingError(err) {
+				// Retry the same page in place instead of returning out of Fetch: bailing here
+				// would discard the events and nextToken already accumulated from earlier pages,
+				// and since their event IDs are already in pastEventIDs, the next Fetch call would
+				// treat page 1 as "already seen" and never walk past it again.
+				backoff := jitteredBackoff(s.backoffAttempt)
+				s.backoffAttempt++
+				time.Sleep(backoff)
+				continue
+			}
 			return next, fmt.Errorf("describe stack events %s: %w", s.stackName, err)
 		}
+		s.backoffAttempt = 0
 
 		var finished bool
 		for _, event := range out.StackEvents {
@@ -80,13 +388,31 @@ func (s *StackStreamer) Fetch() (next time.Time, err error) {
 				finished = true
 				break
 			}
+			logicalID := aws.StringValue(event.LogicalResourceId)
+			resourceType := aws.StringValue(event.ResourceType)
+			status := aws.StringValue(event.ResourceStatus)
+			reason := aws.StringValue(event.ResourceStatusReason)
 			events = append(events, StackEvent{
-				LogicalResourceID:    aws.StringValue(event.LogicalResourceId),
-				ResourceType:         aws.StringValue(event.ResourceType),
-				ResourceStatus:       aws.StringValue(event.ResourceStatus),
-				ResourceStatusReason: aws.StringValue(event.ResourceStatusReason),
+				LogicalResourceID:    logicalID,
+				ResourceType:         resourceType,
+				ResourceStatus:       status,
+				ResourceStatusReason: reason,
+				Prefix:               s.prefix,
 			})
 			s.pastEventIDs[aws.StringValue(event.EventId)] = true
+
+			if reason != "" && failureStatusPattern.MatchString(status) {
+				s.failureReasons = append(s.failureReasons, reason)
+			}
+			if logicalID != s.rootName && resourceType == nestedStackResourceType && nestedStackInProgressStatuses[status] {
+				s.spawnNestedStreamer(logicalID, aws.StringValue(event.PhysicalResourceId))
+			}
+			if !s.isDone && logicalID == s.rootName && terminalStatuses[status] {
+				s.isDone = true
+				terminalStatus = status
+				finished = true
+				break
+			}
 		}
 		if finished || out.NextToken == nil {
 			break
@@ -97,23 +423,88 @@ func (s *StackStreamer) Fetch() (next time.Time, err error) {
 	// Store events to flush in chronological order.
 	reverse(events)
 	s.eventsToFlush = append(s.eventsToFlush, events...)
-	return time.Now().Add(stackFetchIntervalDuration), nil
+
+	// Fetch each child that's due, respecting the adaptive interval it returned last time instead of
+	// re-fetching it every time the root is fetched: a child idling at idleFetchInterval shouldn't be
+	// polled every activeFetchInterval just because the root stack itself is busy. This also fetches
+	// children before reporting the root's terminal result below, so that a nested stack's failure
+	// reason observed in this same round is already folded into collectFailureReasons.
+	now := time.Now()
+	for _, child := range s.children {
+		if now.Before(child.nextFetchAt) {
+			continue
+		}
+		childNext, err := child.Fetch()
+		if err != nil {
+			return next, err
+		}
+		child.nextFetchAt = childNext
+	}
+
+	if terminalStatus != "" {
+		s.done <- StackResult{
+			Status:         terminalStatus,
+			FailureReasons: s.collectFailureReasons(),
+		}
+		close(s.done)
+	}
+	return time.Now().Add(nextFetchInterval(events)), nil
+}
+
+// collectFailureReasons returns the failure reasons recorded by this streamer and, recursively, by
+// every nested stack streamer spawned from it, so that a failure buried in a nested stack (e.g. an
+// addons or env-controller stack) is still surfaced in the root's StackResult.
+func (s *StackStreamer) collectFailureReasons() []string {
+	reasons := append([]string(nil), s.failureReasons...)
+	for _, child := range s.children {
+		reasons = append(reasons, child.collectFailureReasons()...)
+	}
+	return reasons
 }
 
-// Notify flushes all new events to the streamer's subscribers.
+// spawnNestedStreamer starts streaming events from the nested stack identified by physicalID
+// (its ARN), tagging its events with logicalID so subscribers can tell which parent resource it
+// belongs to. A nested stack is only ever spawned once, the first time it's observed.
+//
+// The child is handed a snapshot of s.subscribers taken at spawn time: all calls to Subscribe must
+// happen before the first Fetch that could spawn a nested stack, since a subscriber added afterward
+// would be wired up to the root and any already-spawned children but not to this one.
+func (s *StackStreamer) spawnNestedStreamer(logicalID, physicalID string) {
+	if physicalID == "" || s.nestedStackIDs[physicalID] {
+		return
+	}
+	s.nestedStackIDs[physicalID] = true
+
+	child := newStackStreamer(s.client, physicalID, s.prefix+logicalID+"/", s.changeSetCreationTime, WithRateLimiter(s.limiter))
+	child.subscribers = s.subscribers // Share the same subscriptions; no new queues or goroutines needed.
+	s.children = append(s.children, child)
+}
+
+// Notify enqueues all new events to the streamer's subscribers, including those collected by any
+// nested stacks. Each subscription drains its own bounded queue on its own goroutine, so Notify
+// doesn't wait for a subscriber to receive an event; once a subscription's queue is full, its policy
+// applies: DropOldestSubscriber and DropNewestSubscriber discard an event, while BlockingSubscriber
+// makes Notify wait until the queue has room.
 func (s *StackStreamer) Notify() {
 	for _, event := range s.eventsToFlush {
 		for _, sub := range s.subscribers {
-			sub <- event
+			sub.enqueue(event)
 		}
 	}
 	s.eventsToFlush = nil // reset after flushing all events.
+
+	for _, child := range s.children {
+		child.Notify()
+	}
 }
 
-// Stop closes all subscribed channels notifying them that no more events will be sent.
+// Stop closes all subscribers' queues, notifying them that no more events will be sent once they've
+// drained whatever was already buffered. It should only be called on the root StackStreamer: child
+// streamers spawned for nested stacks share the same subscriptions and stop fetching on their own
+// once the root stack is done.
 func (s *StackStreamer) Stop() {
 	for _, sub := range s.subscribers {
-		close(sub)
+		sub.close()
 	}
 }
 
@@ -0,0 +1,196 @@
+package stream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStackEventsDescriber serves DescribeStackEvents pages keyed by the requested NextToken,
+// throttling a configurable number of times before returning each page's real response.
+type fakeStackEventsDescriber struct {
+	pages         map[string]*cloudformation.DescribeStackEventsOutput
+	throttleTimes map[string]int // Remaining number of times to throttle a given token before succeeding.
+	calls         map[string]int
+}
+
+func (f *fakeStackEventsDescriber) DescribeStackEvents(in *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	token := aws.StringValue(in.NextToken)
+	f.calls[token]++
+	if f.throttleTimes[token] > 0 {
+		f.throttleTimes[token]--
+		return nil, awserr.New("Throttling", "rate exceeded", nil)
+	}
+	out, ok := f.pages[token]
+	if !ok {
+		return nil, fmt.Errorf("no page stubbed for token %q", token)
+	}
+	return out, nil
+}
+
+func TestStackStreamer_Fetch_RetriesThrottledPageWithoutLosingEarlierPages(t *testing.T) {
+	csTime := time.Now().Add(-time.Hour)
+	inProgress := &cloudformation.StackEvent{
+		EventId:           aws.String("evt-in-progress"),
+		LogicalResourceId: aws.String("Table"),
+		ResourceType:      aws.String("AWS::DynamoDB::Table"),
+		ResourceStatus:    aws.String("CREATE_IN_PROGRESS"),
+		Timestamp:         aws.Time(csTime.Add(time.Minute)),
+	}
+	terminal := &cloudformation.StackEvent{
+		EventId:           aws.String("evt-terminal"),
+		LogicalResourceId: aws.String("my-stack"),
+		ResourceType:      aws.String(nestedStackResourceType),
+		ResourceStatus:    aws.String("UPDATE_COMPLETE"),
+		Timestamp:         aws.Time(csTime.Add(2 * time.Minute)),
+	}
+
+	fake := &fakeStackEventsDescriber{
+		pages: map[string]*cloudformation.DescribeStackEventsOutput{
+			"": {
+				StackEvents: []*cloudformation.StackEvent{inProgress},
+				NextToken:   aws.String("page2"),
+			},
+			"page2": {
+				StackEvents: []*cloudformation.StackEvent{terminal},
+			},
+		},
+		throttleTimes: map[string]int{"page2": 1}, // Throttle once on page 2, then succeed.
+		calls:         make(map[string]int),
+	}
+
+	s := NewStackStreamer(fake, "my-stack", csTime)
+	_, err := s.Fetch()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, fake.calls[""], "page 1 should only ever be requested once")
+	require.Equal(t, 2, fake.calls["page2"], "page 2 should be retried in place after being throttled")
+
+	require.Len(t, s.eventsToFlush, 2, "events from both pages should survive the mid-pagination throttle")
+
+	select {
+	case result := <-s.Done():
+		require.Equal(t, "UPDATE_COMPLETE", result.Status)
+	default:
+		t.Fatal("Done() should have fired: the terminal event on the throttled page must still be processed")
+	}
+}
+
+// fakeMultiStackDescriber serves DescribeStackEvents output keyed by the requested StackName, so it
+// can stand in for a root stack and its nested stacks at once.
+type fakeMultiStackDescriber struct {
+	byStack map[string]*cloudformation.DescribeStackEventsOutput
+	calls   map[string]int
+}
+
+func (f *fakeMultiStackDescriber) DescribeStackEvents(in *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	name := aws.StringValue(in.StackName)
+	f.calls[name]++
+	out, ok := f.byStack[name]
+	if !ok {
+		return nil, fmt.Errorf("no events stubbed for stack %q", name)
+	}
+	return out, nil
+}
+
+func TestStackStreamer_Fetch_SpawnsNestedStreamerOnceAndTagsItsEventsWithPrefix(t *testing.T) {
+	csTime := time.Now().Add(-time.Hour)
+	nestedARN := "arn:aws:cloudformation:us-west-2:123456789012:stack/my-stack-Addons-ABC123/11111111-1111-1111-1111-111111111111"
+
+	nestedStart := &cloudformation.StackEvent{
+		EventId:            aws.String("evt-nested-start"),
+		LogicalResourceId:  aws.String("Addons"),
+		ResourceType:       aws.String(nestedStackResourceType),
+		ResourceStatus:     aws.String("CREATE_IN_PROGRESS"),
+		PhysicalResourceId: aws.String(nestedARN),
+		Timestamp:          aws.Time(csTime.Add(time.Minute)),
+	}
+	nestedBucket := &cloudformation.StackEvent{
+		EventId:           aws.String("evt-nested-bucket"),
+		LogicalResourceId: aws.String("Bucket"),
+		ResourceType:      aws.String("AWS::S3::Bucket"),
+		ResourceStatus:    aws.String("CREATE_COMPLETE"),
+		Timestamp:         aws.Time(csTime.Add(2 * time.Minute)),
+	}
+
+	fake := &fakeMultiStackDescriber{
+		byStack: map[string]*cloudformation.DescribeStackEventsOutput{
+			"my-stack": {StackEvents: []*cloudformation.StackEvent{nestedStart}},
+			nestedARN:  {StackEvents: []*cloudformation.StackEvent{nestedBucket}},
+		},
+		calls: make(map[string]int),
+	}
+
+	s := NewStackStreamer(fake, "my-stack", csTime)
+	ch := make(chan StackEvent, 10)
+	s.Subscribe(ch, BlockingSubscriber) // Subscribe must happen before the first Fetch; see Subscribe's doc comment.
+
+	_, err := s.Fetch()
+	require.NoError(t, err)
+	require.Len(t, s.children, 1, "a child streamer should be spawned for the nested stack")
+
+	// Fetching again while CloudFormation still reports the nested stack as CREATE_IN_PROGRESS must
+	// not spawn a second child for the same PhysicalResourceId.
+	_, err = s.Fetch()
+	require.NoError(t, err)
+	require.Len(t, s.children, 1)
+
+	s.Notify() // Notify must recurse into children so their flushed events reach shared subscribers too.
+	s.Stop()
+
+	var got []StackEvent
+	for event := range ch {
+		got = append(got, event)
+	}
+	require.Len(t, got, 2)
+	require.Equal(t, "", got[0].Prefix, "the root's own events aren't prefixed")
+	require.Equal(t, "Bucket", got[1].LogicalResourceID)
+	require.Equal(t, "Addons/", got[1].Prefix, "the nested stack's events should be tagged with its parent's logical ID")
+}
+
+func TestStackStreamer_CollectFailureReasons_IncludesNestedStacks(t *testing.T) {
+	root := NewStackStreamer(&fakeStackEventsDescriber{pages: map[string]*cloudformation.DescribeStackEventsOutput{}, calls: map[string]int{}}, "my-stack", time.Now())
+	root.failureReasons = []string{"root resource failed"}
+
+	addons := newStackStreamer(root.client, "my-stack-Addons-ABC123", "Addons/", root.changeSetCreationTime)
+	addons.failureReasons = []string{"bucket policy failed"}
+	root.children = append(root.children, addons)
+
+	require.ElementsMatch(t, []string{"root resource failed", "bucket policy failed"}, root.collectFailureReasons())
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	testCases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"throttling code":     {awserr.New("Throttling", "slow down", nil), true},
+		"request limit code":  {awserr.New("RequestLimitExceeded", "slow down", nil), true},
+		"unrelated aws error": {awserr.New("ValidationError", "bad input", nil), false},
+		"non-aws error":       {fmt.Errorf("some other error"), false},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, isThrottlingError(tc.err))
+		})
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		backoff := jitteredBackoff(attempt)
+		require.GreaterOrEqual(t, backoff, time.Duration(0))
+		require.LessOrEqual(t, backoff, maxBackoff)
+	}
+}
+
+func TestNextFetchInterval(t *testing.T) {
+	require.Equal(t, idleFetchInterval, nextFetchInterval(nil))
+	require.Equal(t, activeFetchInterval, nextFetchInterval([]StackEvent{{ResourceStatus: "CREATE_IN_PROGRESS"}}))
+	require.Equal(t, defaultFetchInterval, nextFetchInterval([]StackEvent{{ResourceStatus: "CREATE_COMPLETE"}}))
+}
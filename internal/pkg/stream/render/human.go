@@ -0,0 +1,128 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/copilot-cli/internal/pkg/stream"
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+// resourceState tracks the latest known status of a single resource across the events seen for it.
+type resourceState struct {
+	name  string // Prefix + LogicalResourceID, e.g. "Env/Addons/BucketPolicy".
+	start time.Time
+
+	status string
+	reason string
+}
+
+// HumanRenderer renders stack events as a live, in-place updating list of resources with a sticky
+// summary footer. It redraws in place when writing to a TTY, and falls back to appending one line
+// per event otherwise (e.g. when output is redirected to a file or piped in CI).
+type HumanRenderer struct {
+	out   io.Writer
+	isTTY bool
+
+	order      []string // Resource names, in the order they were first observed.
+	resources  map[string]*resourceState
+	drawnLines int // Number of lines drawn on the previous redraw, so we know how far to rewind.
+}
+
+// NewHumanRenderer creates a HumanRenderer that writes its live view to out.
+func NewHumanRenderer(out io.Writer) *HumanRenderer {
+	isTTY := false
+	if f, ok := out.(*os.File); ok {
+		isTTY = term.IsTerminal(int(f.Fd()))
+	}
+	return &HumanRenderer{
+		out:       out,
+		isTTY:     isTTY,
+		resources: make(map[string]*resourceState),
+	}
+}
+
+// Render consumes events from sub, updating the live view each time a resource's status changes,
+// until sub is closed.
+func (r *HumanRenderer) Render(sub <-chan stream.StackEvent) error {
+	for event := range sub {
+		r.draw(r.apply(event))
+	}
+	if !r.isTTY {
+		fmt.Fprintln(r.out, r.footer())
+	}
+	return nil
+}
+
+// apply updates the resource touched by event and returns it, so draw knows what to render.
+func (r *HumanRenderer) apply(event stream.StackEvent) *resourceState {
+	name := event.Prefix + event.LogicalResourceID
+	res, ok := r.resources[name]
+	if !ok {
+		res = &resourceState{
+			name:  name,
+			start: time.Now(),
+		}
+		r.resources[name] = res
+		r.order = append(r.order, name)
+	}
+	res.status = event.ResourceStatus
+	res.reason = event.ResourceStatusReason
+	return res
+}
+
+// draw rewrites the previously drawn lines in place when writing to a TTY. Otherwise it appends
+// only the single line for the resource that just changed, so redirected/piped output (e.g. CI
+// logs) grows with the number of events instead of replaying the whole table on every event.
+func (r *HumanRenderer) draw(changed *resourceState) {
+	if !r.isTTY {
+		fmt.Fprintln(r.out, formatResourceLine(changed))
+		return
+	}
+	if r.drawnLines > 0 {
+		fmt.Fprintf(r.out, "\x1b[%dA\x1b[J", r.drawnLines) // Move cursor up and clear to end of screen.
+	}
+	for _, name := range r.order {
+		fmt.Fprintln(r.out, formatResourceLine(r.resources[name]))
+	}
+	fmt.Fprintln(r.out, r.footer())
+	r.drawnLines = len(r.order) + 1
+}
+
+func formatResourceLine(res *resourceState) string {
+	elapsed := time.Since(res.start).Round(time.Second)
+	line := fmt.Sprintf("%-50s %-24s %6s", res.name, res.status, elapsed)
+	switch {
+	case isFailureStatus(res.status):
+		line = color.RedString(line)
+	case isInProgressStatus(res.status):
+		line = color.YellowString(line)
+	case isCompleteStatus(res.status):
+		line = color.GreenString(line)
+	}
+	if res.reason != "" {
+		line += " " + res.reason
+	}
+	return line
+}
+
+// footer summarizes the terminal resource statuses observed so far.
+func (r *HumanRenderer) footer() string {
+	var added, updated, removed, failed int
+	for _, res := range r.resources {
+		switch {
+		case isFailureStatus(res.status):
+			failed++
+		case res.status == "CREATE_COMPLETE":
+			added++
+		case res.status == "UPDATE_COMPLETE":
+			updated++
+		case res.status == "DELETE_COMPLETE":
+			removed++
+		}
+	}
+	return fmt.Sprintf("Resources: %d added, %d updated, %d removed, %d failed", added, updated, removed, failed)
+}
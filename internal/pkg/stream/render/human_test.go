@@ -0,0 +1,38 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/copilot-cli/internal/pkg/stream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHumanRenderer_NonTTY_AppendsOneLinePerEventNotTheWholeTable(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewHumanRenderer(&buf) // buf isn't an *os.File, so isTTY is false.
+
+	ch := make(chan stream.StackEvent)
+	done := make(chan error, 1)
+	go func() { done <- r.Render(ch) }()
+
+	events := []stream.StackEvent{
+		{LogicalResourceID: "A", ResourceStatus: "CREATE_IN_PROGRESS"},
+		{LogicalResourceID: "A", ResourceStatus: "CREATE_COMPLETE"},
+		{LogicalResourceID: "B", ResourceStatus: "CREATE_IN_PROGRESS"},
+		{LogicalResourceID: "B", ResourceStatus: "CREATE_COMPLETE"},
+		{LogicalResourceID: "C", ResourceStatus: "CREATE_FAILED"},
+	}
+	for _, event := range events {
+		ch <- event
+	}
+	close(ch)
+	require.NoError(t, <-done)
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	// One line per event plus a single trailing footer, not a replayed snapshot of the whole table
+	// on every event (which would grow quadratically: 2+2+3+3+4 lines for these 5 events).
+	require.Len(t, lines, len(events)+1)
+	require.Contains(t, lines[len(lines)-1], "Resources:")
+}
@@ -0,0 +1,45 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/copilot-cli/internal/pkg/stream"
+)
+
+// jsonStackEvent is the wire format emitted by JSONRenderer, one per line.
+type jsonStackEvent struct {
+	Prefix               string `json:"prefix,omitempty"`
+	LogicalResourceID    string `json:"logicalResourceId"`
+	ResourceType         string `json:"resourceType"`
+	ResourceStatus       string `json:"resourceStatus"`
+	ResourceStatusReason string `json:"resourceStatusReason,omitempty"`
+}
+
+// JSONRenderer renders stack events as one JSON object per line, for machine consumption or CI logs.
+type JSONRenderer struct {
+	out io.Writer
+}
+
+// NewJSONRenderer creates a JSONRenderer that writes its output to out.
+func NewJSONRenderer(out io.Writer) *JSONRenderer {
+	return &JSONRenderer{out: out}
+}
+
+// Render consumes events from sub, writing each as a JSON object, until sub is closed.
+func (r *JSONRenderer) Render(sub <-chan stream.StackEvent) error {
+	enc := json.NewEncoder(r.out)
+	for event := range sub {
+		if err := enc.Encode(jsonStackEvent{
+			Prefix:               event.Prefix,
+			LogicalResourceID:    event.LogicalResourceID,
+			ResourceType:         event.ResourceType,
+			ResourceStatus:       event.ResourceStatus,
+			ResourceStatusReason: event.ResourceStatusReason,
+		}); err != nil {
+			return fmt.Errorf("encode stack event for %s: %w", event.LogicalResourceID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/copilot-cli/internal/pkg/stream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONRenderer_Render(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSONRenderer(&buf)
+
+	ch := make(chan stream.StackEvent, 1)
+	ch <- stream.StackEvent{
+		LogicalResourceID: "Bucket",
+		ResourceType:      "AWS::S3::Bucket",
+		ResourceStatus:    "CREATE_COMPLETE",
+	}
+	close(ch)
+
+	require.NoError(t, r.Render(ch))
+	require.JSONEq(t, `{"logicalResourceId":"Bucket","resourceType":"AWS::S3::Bucket","resourceStatus":"CREATE_COMPLETE"}`, buf.String())
+}
@@ -0,0 +1,31 @@
+// Package render provides live views of a stream.StackStreamer's events.
+package render
+
+import (
+	"strings"
+
+	"github.com/aws/copilot-cli/internal/pkg/stream"
+)
+
+// Renderer consumes a stream of stack events and renders a view of deployment progress with them.
+// Render returns once sub is closed, which happens when the underlying StackStreamer is stopped.
+type Renderer interface {
+	Render(sub <-chan stream.StackEvent) error
+}
+
+// isFailureStatus returns true if status ends in _FAILED or starts with ROLLBACK_.
+// Update rollback statuses such as UPDATE_ROLLBACK_IN_PROGRESS are not matched.
+func isFailureStatus(status string) bool {
+	return strings.HasSuffix(status, "_FAILED") || strings.HasPrefix(status, "ROLLBACK_")
+}
+
+// isInProgressStatus returns true if status indicates the resource is still being acted on.
+func isInProgressStatus(status string) bool {
+	return strings.HasSuffix(status, "_IN_PROGRESS")
+}
+
+// isCompleteStatus returns true if status ends in _COMPLETE and isn't a failure status.
+// This includes UPDATE_ROLLBACK_COMPLETE.
+func isCompleteStatus(status string) bool {
+	return strings.HasSuffix(status, "_COMPLETE") && !isFailureStatus(status)
+}
@@ -0,0 +1,79 @@
+package stream
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSubscription builds a subscription without starting its forward goroutine, so enqueue's
+// drop-policy logic can be exercised deterministically, independent of how fast forward drains it.
+func newTestSubscription(policy SubscriberPolicy) *subscription {
+	sub := &subscription{
+		out:    make(chan StackEvent),
+		policy: policy,
+	}
+	sub.cond = sync.NewCond(&sub.mu)
+	return sub
+}
+
+func TestSubscription_DropNewestSubscriber_KeepsOldestEvents(t *testing.T) {
+	sub := newTestSubscription(DropNewestSubscriber)
+
+	total := subscriberQueueSize + 5
+	for i := 0; i < total; i++ {
+		sub.enqueue(StackEvent{LogicalResourceID: fmt.Sprintf("r%d", i)})
+	}
+
+	require.Len(t, sub.queue, subscriberQueueSize)
+	require.EqualValues(t, 5, sub.dropped)
+	require.Equal(t, "r0", sub.queue[0].LogicalResourceID, "oldest buffered event should be kept")
+	require.Equal(t, fmt.Sprintf("r%d", subscriberQueueSize-1), sub.queue[len(sub.queue)-1].LogicalResourceID)
+}
+
+func TestSubscription_DropOldestSubscriber_KeepsNewestEvents(t *testing.T) {
+	sub := newTestSubscription(DropOldestSubscriber)
+
+	total := subscriberQueueSize + 5
+	for i := 0; i < total; i++ {
+		sub.enqueue(StackEvent{LogicalResourceID: fmt.Sprintf("r%d", i)})
+	}
+
+	require.Len(t, sub.queue, subscriberQueueSize)
+	require.EqualValues(t, 5, sub.dropped)
+	require.Equal(t, "r5", sub.queue[0].LogicalResourceID, "the 5 oldest events should have been evicted")
+	require.Equal(t, fmt.Sprintf("r%d", total-1), sub.queue[len(sub.queue)-1].LogicalResourceID, "newest event should be kept")
+}
+
+func TestSubscription_BlockingSubscriber_DeliversEveryEventInOrder(t *testing.T) {
+	out := make(chan StackEvent)
+	sub := newSubscription(out, BlockingSubscriber)
+
+	total := subscriberQueueSize + 50
+	go func() {
+		for i := 0; i < total; i++ {
+			sub.enqueue(StackEvent{LogicalResourceID: fmt.Sprintf("r%d", i)})
+		}
+		sub.close()
+	}()
+
+	var got []string
+	for event := range out {
+		got = append(got, event.LogicalResourceID)
+	}
+
+	require.Len(t, got, total)
+	for i, id := range got {
+		require.Equal(t, fmt.Sprintf("r%d", i), id)
+	}
+	require.EqualValues(t, 0, sub.dropped)
+}
+
+func TestStackStreamer_Dropped_UnknownSubscriberReturnsZero(t *testing.T) {
+	s := NewStackStreamer(&fakeStackEventsDescriber{pages: map[string]*cloudformation.DescribeStackEventsOutput{}, calls: map[string]int{}}, "my-stack", time.Now())
+	require.Equal(t, 0, s.Dropped(make(chan StackEvent)))
+}